@@ -0,0 +1,314 @@
+package builder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"go.uber.org/multierr"
+)
+
+// ArchiveFormat identifies the packaging format wrapped around a built
+// binary.
+type ArchiveFormat string
+
+const (
+	TarGz ArchiveFormat = "tar.gz"
+	Zip   ArchiveFormat = "zip"
+	Deb   ArchiveFormat = "deb"
+)
+
+// ArchiveFile is one extra file bundled into an archive alongside the
+// binary - e.g. a README, LICENSE, AUTHORS, or (for Deb) a systemd unit.
+type ArchiveFile struct {
+	Source string      // path on disk to read the file from
+	Name   string      // path the file is written to inside the archive
+	Perm   os.FileMode // permission bits to record for the file
+}
+
+// ArchiveTarget wraps an underlying build Target with the packaging Format
+// and extra files samulator should bundle around the binary it produces.
+type ArchiveTarget struct {
+	Target   Target
+	Format   ArchiveFormat
+	Manifest []ArchiveFile
+}
+
+// filename returns the archive's output name, e.g.
+// "openbazaard-v0.14.0-linux-amd64.tar.gz".
+func (at ArchiveTarget) filename(label, version string) string {
+	var ext = string(at.Format)
+	if at.Format == Deb {
+		ext = "deb"
+	}
+	return fmt.Sprintf("%s-%s-%s-%s.%s", label, version, at.Target.GOOS, at.Target.GOARCH, ext)
+}
+
+// Archive builds each ArchiveTarget's underlying Target and assembles the
+// requested archive/package around the resulting binary, writing archives
+// into destDir and returning the path to each one produced. As with Build,
+// per-target failures - whether the build itself or the packaging step - are
+// aggregated via multierr rather than aborting the whole batch.
+func (b *openBazaarBuilder) Archive(ctx context.Context, destDir string, targets ...ArchiveTarget) ([]string, error) {
+	var buildTargets = make([]Target, len(targets))
+	for i, at := range targets {
+		buildTargets[i] = at.Target
+	}
+
+	runners, err := b.buildOrdered(ctx, buildTargets)
+	if err != nil {
+		err = fmt.Errorf("building targets to archive: %s", err.Error())
+	}
+
+	if mkerr := os.MkdirAll(destDir, 0755); mkerr != nil {
+		return nil, multierr.Append(err, fmt.Errorf("preparing dest dir: %s", mkerr.Error()))
+	}
+
+	var archives []string
+	for i, at := range targets {
+		if runners[i] == nil {
+			continue // that Target's build already failed and was recorded in err
+		}
+		path, packErr := assembleArchive(runners[i].BinaryPath(), destDir, b.friendlyLabel, b.versionReference, at)
+		if packErr != nil {
+			err = multierr.Append(err, fmt.Errorf("packaging %s (%s): %s", at.Target, at.Format, packErr.Error()))
+			continue
+		}
+		archives = append(archives, path)
+	}
+	return archives, err
+}
+
+func assembleArchive(binaryPath, destDir, label, version string, at ArchiveTarget) (string, error) {
+	var dest = filepath.Join(destDir, at.filename(label, version))
+	switch at.Format {
+	case TarGz:
+		return dest, writeTarGz(dest, binaryPath, at)
+	case Zip:
+		return dest, writeZip(dest, binaryPath, at)
+	case Deb:
+		return dest, writeDeb(dest, binaryPath, label, version, at)
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s", at.Format)
+	}
+}
+
+func writeTarGz(dest, binaryPath string, at ArchiveTarget) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("creating archive: %s", err.Error())
+	}
+	defer out.Close()
+
+	var gzw = gzip.NewWriter(out)
+	defer gzw.Close()
+	var tw = tar.NewWriter(gzw)
+	defer tw.Close()
+
+	if err := addTarFile(tw, binaryPath, filepath.Base(binaryPath), 0755); err != nil {
+		return err
+	}
+	for _, f := range at.Manifest {
+		if err := addTarFile(tw, f.Source, f.Name, f.Perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addTarFile(tw *tar.Writer, source, name string, perm os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("opening %s: %s", source, err.Error())
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %s", source, err.Error())
+	}
+	var hdr = &tar.Header{
+		Name: name,
+		Mode: int64(perm),
+		Size: info.Size(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing tar header for %s: %s", name, err.Error())
+	}
+	if _, err := io.Copy(tw, in); err != nil {
+		return fmt.Errorf("writing %s into archive: %s", name, err.Error())
+	}
+	return nil
+}
+
+func writeZip(dest, binaryPath string, at ArchiveTarget) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("creating archive: %s", err.Error())
+	}
+	defer out.Close()
+
+	var zw = zip.NewWriter(out)
+	defer zw.Close()
+
+	if err := addZipFile(zw, binaryPath, filepath.Base(binaryPath), 0755); err != nil {
+		return err
+	}
+	for _, f := range at.Manifest {
+		if err := addZipFile(zw, f.Source, f.Name, f.Perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addZipFile(zw *zip.Writer, source, name string, perm os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("opening %s: %s", source, err.Error())
+	}
+	defer in.Close()
+
+	var hdr = &zip.FileHeader{Name: name, Method: zip.Deflate}
+	hdr.SetMode(perm)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("adding %s to archive: %s", name, err.Error())
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return fmt.Errorf("writing %s into archive: %s", name, err.Error())
+	}
+	return nil
+}
+
+// writeDeb assembles a minimal binary .deb: an ar archive containing
+// debian-binary, control.tar.gz (control file derived from label/version),
+// and data.tar.gz (the binary plus the archive's manifest, laid out under
+// /usr/bin and wherever the manifest's Name paths say).
+func writeDeb(dest, binaryPath, label, version string, at ArchiveTarget) error {
+	dataTarGz, err := tarGzBytes(func(tw *tar.Writer) error {
+		// Tar entry names are POSIX paths and must always use "/", so this
+		// uses path.Join rather than filepath.Join - on a Windows build
+		// host, filepath.Join would write "usr\bin\<label>" into the tar
+		// stream and produce a broken .deb.
+		if err := addTarFile(tw, binaryPath, path.Join("usr", "bin", label), 0755); err != nil {
+			return err
+		}
+		for _, f := range at.Manifest {
+			if err := addTarFile(tw, f.Source, f.Name, f.Perm); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("building data.tar.gz: %s", err.Error())
+	}
+
+	controlTarGz, err := tarGzBytes(func(tw *tar.Writer) error {
+		var control = debControlFile(label, version, at.Target)
+		if err := tw.WriteHeader(&tar.Header{Name: "control", Mode: 0644, Size: int64(len(control))}); err != nil {
+			return fmt.Errorf("writing control tar header: %s", err.Error())
+		}
+		_, err := tw.Write(control)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("building control.tar.gz: %s", err.Error())
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("creating deb: %s", err.Error())
+	}
+	defer out.Close()
+
+	return writeAr(out, []arEntry{
+		{name: "debian-binary", content: []byte("2.0\n")},
+		{name: "control.tar.gz", content: controlTarGz},
+		{name: "data.tar.gz", content: dataTarGz},
+	})
+}
+
+// debArchNames maps Go's GOARCH to the architecture names dpkg expects in a
+// control file - they don't always agree (386 vs i386, arm vs armhf).
+var debArchNames = map[string]string{
+	"amd64": "amd64",
+	"arm64": "arm64",
+	"386":   "i386",
+	"arm":   "armhf",
+}
+
+// debArch renders t's GOARCH as a Debian architecture name, falling back to
+// the GOARCH string itself for anything not in debArchNames (e.g. mips,
+// ppc64le - dpkg accepts those verbatim too).
+func debArch(t Target) string {
+	if name, ok := debArchNames[t.GOARCH]; ok {
+		return name
+	}
+	return t.GOARCH
+}
+
+// debControlFile renders a minimal Debian control file, deriving Package and
+// Version from the friendly label and versionReference samulator was
+// configured with, and Architecture from the build Target.
+func debControlFile(label, version string, t Target) []byte {
+	return []byte(fmt.Sprintf(
+		"Package: %s\nVersion: %s\nArchitecture: %s\nMaintainer: OpenBazaar\nDescription: %s daemon, packaged by samulator\n",
+		label, version, debArch(t), label,
+	))
+}
+
+func tarGzBytes(write func(tw *tar.Writer) error) ([]byte, error) {
+	var buf bytes.Buffer
+	var gzw = gzip.NewWriter(&buf)
+	var tw = tar.NewWriter(gzw)
+	if err := write(tw); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("closing tar writer: %s", err.Error())
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, fmt.Errorf("closing gzip writer: %s", err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// arEntry is one member of a Unix ar archive - the container format .deb
+// files use to hold debian-binary, control.tar.gz, and data.tar.gz.
+type arEntry struct {
+	name    string
+	content []byte
+}
+
+// writeAr writes entries as a Unix ar archive using the common (BSD/GNU
+// compatible) fixed-width header format.
+func writeAr(w io.Writer, entries []arEntry) error {
+	if _, err := io.WriteString(w, "!<arch>\n"); err != nil {
+		return fmt.Errorf("writing ar magic: %s", err.Error())
+	}
+	for _, e := range entries {
+		var header = fmt.Sprintf("%-16s%-12d%-6d%-6d%-8s%-10d`\n",
+			e.name, 0 /* mtime */, 0 /* uid */, 0 /* gid */, "100644", len(e.content))
+		if _, err := io.WriteString(w, header); err != nil {
+			return fmt.Errorf("writing ar header for %s: %s", e.name, err.Error())
+		}
+		if _, err := w.Write(e.content); err != nil {
+			return fmt.Errorf("writing ar body for %s: %s", e.name, err.Error())
+		}
+		if len(e.content)%2 != 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return fmt.Errorf("padding ar entry for %s: %s", e.name, err.Error())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package builder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebControlFileArchitecture(t *testing.T) {
+	var cases = []struct {
+		target Target
+		want   string
+	}{
+		{Target{GOOS: "linux", GOARCH: "amd64"}, "amd64"},
+		{Target{GOOS: "linux", GOARCH: "arm64"}, "arm64"},
+		{Target{GOOS: "linux", GOARCH: "386"}, "i386"},
+		{Target{GOOS: "linux", GOARCH: "arm"}, "armhf"},
+		{Target{GOOS: "linux", GOARCH: "mips64"}, "mips64"},
+	}
+	for _, c := range cases {
+		var control = string(debControlFile("openbazaard", "v1.0.0", c.target))
+		var want = "Architecture: " + c.want
+		if !strings.Contains(control, want) {
+			t.Errorf("debControlFile(%s) = %q, want it to contain %q", c.target, control, want)
+		}
+	}
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "archive-test")
+	if err != nil {
+		t.Fatalf("creating temp file: %s", err.Error())
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("writing temp file: %s", err.Error())
+	}
+	return f.Name()
+}
+
+func TestWriteTarGz(t *testing.T) {
+	var binaryPath = writeTempFile(t, "binary-contents")
+	defer os.Remove(binaryPath)
+
+	var dest = filepath.Join(os.TempDir(), "samulator-test.tar.gz")
+	defer os.Remove(dest)
+
+	if err := writeTarGz(dest, binaryPath, ArchiveTarget{}); err != nil {
+		t.Fatalf("writeTarGz: %s", err.Error())
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatalf("opening archive: %s", err.Error())
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %s", err.Error())
+	}
+	var tr = tar.NewReader(gzr)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("reading tar entry: %s", err.Error())
+	}
+	if hdr.Name != filepath.Base(binaryPath) {
+		t.Errorf("entry name = %q, want %q", hdr.Name, filepath.Base(binaryPath))
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(tr); err != nil {
+		t.Fatalf("reading entry contents: %s", err.Error())
+	}
+	if buf.String() != "binary-contents" {
+		t.Errorf("entry contents = %q, want %q", buf.String(), "binary-contents")
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	var binaryPath = writeTempFile(t, "binary-contents")
+	defer os.Remove(binaryPath)
+
+	var dest = filepath.Join(os.TempDir(), "samulator-test.zip")
+	defer os.Remove(dest)
+
+	if err := writeZip(dest, binaryPath, ArchiveTarget{}); err != nil {
+		t.Fatalf("writeZip: %s", err.Error())
+	}
+
+	zr, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatalf("zip.OpenReader: %s", err.Error())
+	}
+	defer zr.Close()
+
+	if len(zr.File) != 1 {
+		t.Fatalf("len(zr.File) = %d, want 1", len(zr.File))
+	}
+	if zr.File[0].Name != filepath.Base(binaryPath) {
+		t.Errorf("entry name = %q, want %q", zr.File[0].Name, filepath.Base(binaryPath))
+	}
+}
+
+func TestWriteAr(t *testing.T) {
+	var buf bytes.Buffer
+	var entries = []arEntry{
+		{name: "debian-binary", content: []byte("2.0\n")},
+		{name: "control.tar.gz", content: []byte("ab")},
+	}
+	if err := writeAr(&buf, entries); err != nil {
+		t.Fatalf("writeAr: %s", err.Error())
+	}
+
+	if !bytes.HasPrefix(buf.Bytes(), []byte("!<arch>\n")) {
+		t.Fatal("archive is missing the ar magic header")
+	}
+	for _, e := range entries {
+		if !bytes.Contains(buf.Bytes(), []byte(e.name)) {
+			t.Errorf("archive is missing entry name %q", e.name)
+		}
+		if !bytes.Contains(buf.Bytes(), e.content) {
+			t.Errorf("archive is missing entry content for %q", e.name)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/OpenBazaar/mason/builder/blueprints"
+	"github.com/OpenBazaar/mason/builder/cacher"
+	"github.com/OpenBazaar/mason/util"
+	"go.uber.org/multierr"
+)
+
+// PerfResult is a single measured metric from one benchmark at one commit,
+// e.g. {Hash: "abc123", Benchmark: "BenchmarkSign", Metric: "ns/op", Value: 842}.
+type PerfResult struct {
+	Hash      string
+	Benchmark string
+	Metric    string
+	Value     float64
+}
+
+// BenchmarkOptions configures a BenchmarkAcross run.
+type BenchmarkOptions struct {
+	// Packages to run `go test -bench` against, relative to the
+	// openbazaar-go repo root (e.g. "core", "repo/db").
+	Packages []string
+	// ReuseWorkpath skips re-inflating the source if the previous
+	// BenchmarkAcross/Build call's workDir is still on disk, just
+	// re-checking-out each commit into it instead.
+	ReuseWorkpath bool
+}
+
+// BenchmarkAcross walks every commit between fromRef and toRef (exclusive of
+// fromRef), building openbazaar-go and running `go test -bench` with
+// -benchmem at each one, so callers can bisect a performance regression
+// across a version range. Results are cached per commit hash, so re-running
+// the same range is cheap except for the commits that are new.
+func (b *openBazaarBuilder) BenchmarkAcross(ctx context.Context, fromRef, toRef string, benchPatterns []string, opts BenchmarkOptions) ([]PerfResult, error) {
+	c, err := cacher.OpenOrCreate(b.cachePath)
+	if err != nil {
+		log.Warningf("failed opening cache (%s): %s", b.cachePath, err.Error())
+	}
+
+	var src *blueprints.OpenBazaarSource
+	b.Lock()
+	if opts.ReuseWorkpath && b.workDir != "" {
+		if src, err = blueprints.FromWorkDir(b.workDir); err == nil {
+			log.Infof("reusing workDir %s", b.workDir)
+		}
+	}
+	if src == nil {
+		b.workDir = util.GenerateTempBuildPath(b.friendlyLabel)
+		src, err = blueprints.InflateOpenBazaarDaemon(b.workDir)
+	}
+	b.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("inflating source: %s", err.Error())
+	}
+
+	commits, err := src.CommitsBetween(fromRef, toRef)
+	if err != nil {
+		return nil, fmt.Errorf("listing commits %s..%s: %s", fromRef, toRef, err.Error())
+	}
+
+	var (
+		results []PerfResult
+		errs    error
+		key     = perfCacheKey(benchPatterns, opts.Packages)
+	)
+	for _, commit := range commits {
+		select {
+		case <-ctx.Done():
+			return results, multierr.Append(errs, ctx.Err())
+		default:
+		}
+
+		r, err := benchmarkCommit(c, src, commit, key, benchPatterns, opts.Packages)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("benchmarking %s: %s", commit, err.Error()))
+			continue
+		}
+		results = append(results, r...)
+	}
+	return results, errs
+}
+
+func benchmarkCommit(c *cacher.Cache, src *blueprints.OpenBazaarSource, commit, key string, patterns, packages []string) ([]PerfResult, error) {
+	if raw, err := c.GetPerfResults(commit, key); err == nil {
+		var cached []PerfResult
+		if err := json.Unmarshal(raw, &cached); err == nil {
+			return cached, nil
+		}
+		log.Warningf("discarding unparsable cached perf results for %s: decode failed", commit)
+	}
+
+	if err := src.CheckoutVersion(commit); err != nil {
+		return nil, fmt.Errorf("checkout: %s", err.Error())
+	}
+
+	output, err := runBenchmarks(src, patterns, packages)
+	if err != nil {
+		return nil, fmt.Errorf("running benchmarks: %s", err.Error())
+	}
+	var results = parseBenchOutput(commit, output)
+
+	raw, err := json.Marshal(results)
+	if err != nil {
+		log.Warningf("failed encoding perf results for %s: %s", commit, err.Error())
+	} else if err := c.CachePerfResults(commit, key, raw); err != nil {
+		log.Warningf("failed caching perf results for %s: %s", commit, err.Error())
+	}
+	return results, nil
+}
+
+// runBenchmarks runs `go test -bench` against each of packages (import
+// paths relative to the openbazaar-go repo root), matching benchPatterns,
+// and returns the raw combined output for parseBenchOutput to pick apart.
+func runBenchmarks(src *blueprints.OpenBazaarSource, benchPatterns, packages []string) (string, error) {
+	var importPaths = make([]string, len(packages))
+	for i, p := range packages {
+		importPaths[i] = path.Join("github.com/OpenBazaar/openbazaar-go", p)
+	}
+
+	var args = append([]string{
+		"test", "-run=^$", "-bench=" + strings.Join(benchPatterns, "|"), "-benchmem",
+	}, importPaths...)
+
+	var cmd = exec.Command("go", args...)
+	cmd.Dir = src.WorkDir()
+	cmd.Env = append(os.Environ(), fmt.Sprintf("GOPATH=%s", src.WorkDir()))
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("go test -bench: %s: %s", err.Error(), string(out))
+	}
+	return string(out), nil
+}
+
+var benchLineRe = regexp.MustCompile(`^(Benchmark\S+)\s+\d+\s+(.+)$`)
+var benchMetricRe = regexp.MustCompile(`([0-9.]+)\s+(\S+)`)
+
+// parseBenchOutput picks the standard `go test -bench -benchmem` table
+// apart into one PerfResult per metric per benchmark line.
+func parseBenchOutput(commit, output string) []PerfResult {
+	var results []PerfResult
+	for _, line := range strings.Split(output, "\n") {
+		var m = benchLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for _, metric := range benchMetricRe.FindAllStringSubmatch(m[2], -1) {
+			value, err := strconv.ParseFloat(metric[1], 64)
+			if err != nil {
+				continue
+			}
+			results = append(results, PerfResult{
+				Hash:      commit,
+				Benchmark: m[1],
+				Metric:    metric[2],
+				Value:     value,
+			})
+		}
+	}
+	return results
+}
+
+func perfCacheKey(patterns, packages []string) string {
+	return strings.Join(patterns, ",") + "|" + strings.Join(packages, ",")
+}
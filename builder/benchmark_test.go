@@ -0,0 +1,41 @@
+package builder
+
+import "testing"
+
+func TestParseBenchOutput(t *testing.T) {
+	var output = `goos: linux
+goarch: amd64
+pkg: github.com/OpenBazaar/openbazaar-go/core
+BenchmarkSign-8       	   20000	     78234 ns/op	    1024 B/op	      12 allocs/op
+BenchmarkVerify-8     	   50000	     30011 ns/op	     512 B/op	       4 allocs/op
+PASS
+ok  	github.com/OpenBazaar/openbazaar-go/core	2.345s
+`
+
+	var results = parseBenchOutput("abc123", output)
+
+	var want = []PerfResult{
+		{Hash: "abc123", Benchmark: "BenchmarkSign-8", Metric: "ns/op", Value: 78234},
+		{Hash: "abc123", Benchmark: "BenchmarkSign-8", Metric: "B/op", Value: 1024},
+		{Hash: "abc123", Benchmark: "BenchmarkSign-8", Metric: "allocs/op", Value: 12},
+		{Hash: "abc123", Benchmark: "BenchmarkVerify-8", Metric: "ns/op", Value: 30011},
+		{Hash: "abc123", Benchmark: "BenchmarkVerify-8", Metric: "B/op", Value: 512},
+		{Hash: "abc123", Benchmark: "BenchmarkVerify-8", Metric: "allocs/op", Value: 4},
+	}
+
+	if len(results) != len(want) {
+		t.Fatalf("len(results) = %d, want %d (results: %+v)", len(results), len(want), results)
+	}
+	for i, r := range results {
+		if r != want[i] {
+			t.Errorf("results[%d] = %+v, want %+v", i, r, want[i])
+		}
+	}
+}
+
+func TestParseBenchOutputIgnoresNonBenchmarkLines(t *testing.T) {
+	var output = "goos: linux\nPASS\nok  \tgithub.com/OpenBazaar/openbazaar-go/core\t0.002s\n"
+	if results := parseBenchOutput("abc123", output); len(results) != 0 {
+		t.Errorf("results = %+v, want none", results)
+	}
+}
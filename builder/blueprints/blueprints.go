@@ -0,0 +1,182 @@
+package blueprints
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	shell "github.com/placer14/go-shell"
+)
+
+// OpenBazaarSource is a checked-out copy of the openbazaar-go source tree,
+// rooted at a GOPATH-shaped workDir so it can be fed straight to xgo.
+type OpenBazaarSource struct {
+	workDir string
+}
+
+// InflateOpenBazaarDaemon clones openbazaar-go into workDir, laid out as a
+// GOPATH so the resulting tree can be built without module support. Every
+// call - even ones destined for a full cache hit, since BuildID needs a
+// resolved commit SHA and blueprint hash that only exist post-checkout -
+// clones from a persistent local mirror (see ensureMirror) rather than the
+// network, so repeated builds only ever pay for the mirror's incremental
+// fetch instead of a full clone of openbazaar-go's history.
+func InflateOpenBazaarDaemon(workDir string) (*OpenBazaarSource, error) {
+	mirror, err := ensureMirror()
+	if err != nil {
+		return nil, fmt.Errorf("preparing source mirror: %s", err.Error())
+	}
+
+	var (
+		srcDir = filepath.Join(workDir, "src", "github.com", "OpenBazaar", "openbazaar-go")
+		clone  = shell.Cmd("git", "clone", mirror, srcDir)
+	)
+	proc := clone.Start()
+	if err := proc.Wait(); err != nil {
+		return nil, fmt.Errorf("(%v) waiting: %s", proc, err.Error())
+	}
+	if proc.ExitStatus != 0 {
+		return nil, fmt.Errorf("non-zero clone exit: %s", proc.Error())
+	}
+	return &OpenBazaarSource{workDir: workDir}, nil
+}
+
+// mirrorDir is the persistent local mirror clone of openbazaar-go shared
+// across every InflateOpenBazaarDaemon call, keyed off HOME the same way
+// NewOpenBazaarDaemon keys its cache path.
+func mirrorDir() string {
+	var homeDir = os.Getenv("HOME")
+	if homeDir == "" {
+		homeDir = "."
+	}
+	return filepath.Join(homeDir, ".mason", "src-mirror", "openbazaar-go")
+}
+
+// ensureMirror makes sure a local --mirror clone of openbazaar-go exists and
+// is up to date, fetching into it if it's already present rather than
+// re-cloning from scratch, and returns its path so callers can clone
+// worktrees from it instead of the network.
+func ensureMirror() (string, error) {
+	var dir = mirrorDir()
+	if _, err := os.Stat(dir); err == nil {
+		proc := shell.Cmd("git", "--git-dir", dir, "fetch", "--all", "--tags").Start()
+		if err := proc.Wait(); err != nil {
+			return "", fmt.Errorf("(%v) waiting: %s", proc, err.Error())
+		}
+		if proc.ExitStatus != 0 {
+			return "", fmt.Errorf("non-zero mirror fetch exit: %s", proc.Error())
+		}
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("preparing mirror dir: %s", err.Error())
+	}
+	proc := shell.Cmd("git", "clone", "--mirror", "https://github.com/OpenBazaar/openbazaar-go", dir).Start()
+	if err := proc.Wait(); err != nil {
+		return "", fmt.Errorf("(%v) waiting: %s", proc, err.Error())
+	}
+	if proc.ExitStatus != 0 {
+		return "", fmt.Errorf("non-zero mirror clone exit: %s", proc.Error())
+	}
+	return dir, nil
+}
+
+// FromWorkDir wraps an already-inflated source tree at workDir rather than
+// cloning a fresh one - used by callers like BenchmarkAcross's
+// -reuse-workpath mode that want to keep checking out commits into the same
+// tree instead of re-cloning for every run.
+func FromWorkDir(workDir string) (*OpenBazaarSource, error) {
+	var s = &OpenBazaarSource{workDir: workDir}
+	if _, err := os.Stat(s.srcDir()); err != nil {
+		return nil, fmt.Errorf("no inflated source at %s: %s", workDir, err.Error())
+	}
+	return s, nil
+}
+
+// CheckoutVersion resets the inflated source to the given ref (tag, branch,
+// or commit SHA).
+func (s *OpenBazaarSource) CheckoutVersion(ref string) error {
+	proc := shell.Cmd("git", "checkout", ref).SetWorkDir(s.srcDir()).Start()
+	if err := proc.Wait(); err != nil {
+		return fmt.Errorf("(%v) waiting: %s", proc, err.Error())
+	}
+	if proc.ExitStatus != 0 {
+		return fmt.Errorf("non-zero checkout exit: %s", proc.Error())
+	}
+	return nil
+}
+
+// Hash returns the commit SHA of the currently checked-out ref.
+func (s *OpenBazaarSource) Hash() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = s.srcDir()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("rev-parse HEAD: %s", err.Error())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CommitsBetween returns the commit SHAs between fromRef and toRef
+// (exclusive of fromRef), oldest first, so BenchmarkAcross can walk a
+// version range in commit order.
+func (s *OpenBazaarSource) CommitsBetween(fromRef, toRef string) ([]string, error) {
+	cmd := exec.Command("git", "rev-list", "--reverse", fmt.Sprintf("%s..%s", fromRef, toRef))
+	cmd.Dir = s.srcDir()
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("rev-list %s..%s: %s", fromRef, toRef, err.Error())
+	}
+
+	var commits []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// InflationHash hashes the path (relative to srcDir, so it's stable across
+// the disposable per-invocation tempdirs util.GenerateTempBuildPath hands
+// out) and size of every file in the inflated source tree, giving a cheap
+// fingerprint of what CheckoutVersion actually produced on disk - fed into
+// cacher.BuildID so a checkout that silently picked up different content
+// invalidates the cache even if the ref name didn't change.
+func (s *OpenBazaarSource) InflationHash() (string, error) {
+	var h = sha256.New()
+	var root = s.srcDir()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("relativizing %s: %s", path, err.Error())
+		}
+		fmt.Fprintf(h, "%s:%d\n", rel, info.Size())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("hashing inflated source: %s", err.Error())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WorkDir returns the GOPATH-shaped root the source was inflated into.
+func (s *OpenBazaarSource) WorkDir() string { return s.workDir }
+
+// BinaryPrefix is the name xgo should give the produced binaries.
+func (s *OpenBazaarSource) BinaryPrefix() string { return "openbazaard" }
+
+func (s *OpenBazaarSource) srcDir() string {
+	return filepath.Join(s.workDir, "src", "github.com", "OpenBazaar", "openbazaar-go")
+}
@@ -0,0 +1,318 @@
+package cacher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/OpenBazaar/mason/filemutex"
+	"github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("cacher")
+
+// BuildID is the composite set of inputs that determine whether a previously
+// cached binary is still valid for a requested build. Hashing it gives the
+// on-disk cache key, so changing any one of these inputs - a compiler flag, a
+// Go version bump, a new commit - automatically invalidates the cache entry,
+// mirroring how cmd/go moved to content-based build staleness.
+type BuildID struct {
+	CommitSHA     string
+	GoVersion     string
+	TargetTriple  string
+	LDFlags       string
+	GCFlags       string
+	GOOS          string
+	GOARCH        string
+	BlueprintHash string
+}
+
+// Hash returns the SHA-256 digest of the BuildID, hex-encoded, used as the
+// on-disk cache key.
+func (id BuildID) Hash() string {
+	var h = sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n",
+		id.CommitSHA, id.GoVersion, id.TargetTriple,
+		id.LDFlags, id.GCFlags, id.GOOS, id.GOARCH, id.BlueprintHash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Cache is an on-disk store of previously-built binaries, keyed by BuildID
+// hash. It also keeps a small manifest of recently-requested hashes so `gc`
+// can tell a stale entry from one that's merely unpopular.
+type Cache struct {
+	root string
+}
+
+// OpenOrCreate opens the cache rooted at path, creating it if necessary.
+func OpenOrCreate(path string) (*Cache, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("creating cache dir (%s): %s", path, err.Error())
+	}
+	return &Cache{root: path}, nil
+}
+
+// Get returns the path to the cached binary for id, and the path to its
+// detached signature if one was cached alongside it (empty if not). It
+// returns an error if the binary isn't present.
+func (c *Cache) Get(id BuildID) (string, string, error) {
+	var entry = c.entryPath(id)
+	if _, err := os.Stat(entry); err != nil {
+		return "", "", fmt.Errorf("cache miss for %s: %s", id.Hash(), err.Error())
+	}
+	if err := c.touch(id.Hash()); err != nil {
+		log.Warningf("failed updating cache manifest: %s", err.Error())
+	}
+	var sigEntry = c.sigPath(id)
+	if _, err := os.Stat(sigEntry); err != nil {
+		return entry, "", nil
+	}
+	return entry, sigEntry, nil
+}
+
+// Cache copies the binary at srcPath into the cache under id's hash. If
+// sigPath is non-empty, the detached signature it points to is cached
+// alongside the binary and returned by later Get calls.
+func (c *Cache) Cache(id BuildID, srcPath, sigPath string) error {
+	var entry = c.entryPath(id)
+	if err := os.MkdirAll(filepath.Dir(entry), 0755); err != nil {
+		return fmt.Errorf("preparing cache entry: %s", err.Error())
+	}
+	if err := copyFile(srcPath, entry); err != nil {
+		return err
+	}
+	if sigPath != "" {
+		if err := copyFile(sigPath, c.sigPath(id)); err != nil {
+			return fmt.Errorf("caching signature: %s", err.Error())
+		}
+	}
+	return c.touch(id.Hash())
+}
+
+func (c *Cache) entryPath(id BuildID) string {
+	return filepath.Join(c.root, id.Hash())
+}
+
+func (c *Cache) sigPath(id BuildID) string {
+	return c.entryPath(id) + ".sig"
+}
+
+// Lock acquires a cross-process exclusive lock for id, so that concurrent
+// mason processes racing on the same build ID block on each other instead
+// of both missing the cache and duplicating the xgo run. Callers should Get
+// again after locking - another process may have populated the entry while
+// this one was waiting - and must Unlock once their build (hit or miss) is
+// complete.
+func (c *Cache) Lock(id BuildID) (*filemutex.FileMutex, error) {
+	var lockPath = c.entryPath(id) + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, fmt.Errorf("preparing lock dir: %s", err.Error())
+	}
+	m, err := filemutex.New(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening lockfile: %s", err.Error())
+	}
+	if err := m.Lock(); err != nil {
+		return nil, fmt.Errorf("locking %s: %s", lockPath, err.Error())
+	}
+	return m, nil
+}
+
+// perfNamespace is the cache subdirectory benchmark results live under,
+// distinct from the binary cache so GC's manifest-based pruning doesn't need
+// to reason about both.
+const perfNamespace = "perf"
+
+// CachePerfResults stores raw benchmark data under commit and key (the
+// patterns/packages a BenchmarkAcross run was invoked with), so re-running
+// the same benchmark request against a commit that's already been measured
+// is a cache hit.
+func (c *Cache) CachePerfResults(commit, key string, data []byte) error {
+	var entry = c.perfPath(commit, key)
+	if err := os.MkdirAll(filepath.Dir(entry), 0755); err != nil {
+		return fmt.Errorf("preparing perf cache entry: %s", err.Error())
+	}
+	return ioutil.WriteFile(entry, data, 0644)
+}
+
+// GetPerfResults returns the raw benchmark data cached for commit and key,
+// or an error if nothing's cached yet.
+func (c *Cache) GetPerfResults(commit, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(c.perfPath(commit, key))
+	if err != nil {
+		return nil, fmt.Errorf("perf cache miss for %s (%s): %s", commit, key, err.Error())
+	}
+	return data, nil
+}
+
+func (c *Cache) perfPath(commit, key string) string {
+	var h = sha256.Sum256([]byte(key))
+	return filepath.Join(c.root, perfNamespace, commit, hex.EncodeToString(h[:])+".json")
+}
+
+// copyFile copies src into dst by writing to a temp file alongside dst and
+// renaming it into place, so a concurrent, unlocked Get can never stat a
+// cache entry that's only partially written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening source: %s", err.Error())
+	}
+	defer in.Close()
+
+	var tmp = dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("creating cache entry: %s", err.Error())
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("copying into cache: %s", err.Error())
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("closing cache entry: %s", err.Error())
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("finalizing cache entry: %s", err.Error())
+	}
+	return nil
+}
+
+// manifestEntry records the last time a given build-ID hash was requested,
+// so GC can distinguish a stale entry from a merely unpopular one.
+type manifestEntry struct {
+	Hash     string    `json:"hash"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+func (c *Cache) manifestPath() string {
+	return filepath.Join(c.root, "manifest.json")
+}
+
+// lockManifest guards the manifest's read-modify-write cycle. Without it,
+// concurrent touch() calls from goroutines building different Targets in
+// the same process (or separate mason processes) can race - each reads the
+// same version, mutates it independently, and the last writer wins,
+// silently losing the other's update. That in turn made GC's "unseen in
+// manifest" check unreliable: a just-built entry whose touch() lost the
+// race looked indistinguishable from a genuinely stale one.
+func (c *Cache) lockManifest() (*filemutex.FileMutex, error) {
+	var lockPath = c.manifestPath() + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, fmt.Errorf("preparing manifest lock dir: %s", err.Error())
+	}
+	m, err := filemutex.New(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening manifest lockfile: %s", err.Error())
+	}
+	if err := m.Lock(); err != nil {
+		return nil, fmt.Errorf("locking manifest: %s", err.Error())
+	}
+	return m, nil
+}
+
+func (c *Cache) readManifest() (map[string]manifestEntry, error) {
+	var entries = map[string]manifestEntry{}
+	raw, err := ioutil.ReadFile(c.manifestPath())
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading manifest: %s", err.Error())
+	}
+	var list []manifestEntry
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %s", err.Error())
+	}
+	for _, e := range list {
+		entries[e.Hash] = e
+	}
+	return entries, nil
+}
+
+func (c *Cache) writeManifest(entries map[string]manifestEntry) error {
+	var list = make([]manifestEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %s", err.Error())
+	}
+	return ioutil.WriteFile(c.manifestPath(), raw, 0644)
+}
+
+func (c *Cache) touch(hash string) error {
+	lock, err := c.lockManifest()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	entries, err := c.readManifest()
+	if err != nil {
+		return err
+	}
+	entries[hash] = manifestEntry{Hash: hash, LastUsed: time.Now()}
+	return c.writeManifest(entries)
+}
+
+// GC removes every cache entry whose build-ID hash hasn't been requested
+// (via Get or Cache) within maxAge, returning the number of entries removed.
+// An entry absent from the manifest isn't assumed stale outright - its
+// touch() may simply not have landed yet (or lost a race to another
+// process) - so GC falls back to the entry's own file mtime before
+// condemning it.
+func (c *Cache) GC(maxAge time.Duration) (int, error) {
+	lock, err := c.lockManifest()
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Unlock()
+
+	entries, err := c.readManifest()
+	if err != nil {
+		return 0, err
+	}
+
+	files, err := ioutil.ReadDir(c.root)
+	if err != nil {
+		return 0, fmt.Errorf("listing cache: %s", err.Error())
+	}
+
+	var removed int
+	var cutoff = time.Now().Add(-maxAge)
+	for _, f := range files {
+		if f.Name() == filepath.Base(c.manifestPath()) || f.Name() == perfNamespace || strings.HasSuffix(f.Name(), ".lock") {
+			continue
+		}
+		var hash = strings.TrimSuffix(f.Name(), ".sig")
+		if entry, seen := entries[hash]; seen {
+			if entry.LastUsed.After(cutoff) {
+				continue
+			}
+		} else if f.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.root, f.Name())); err != nil {
+			return removed, fmt.Errorf("removing stale entry %s: %s", f.Name(), err.Error())
+		}
+		delete(entries, hash)
+		if !strings.HasSuffix(f.Name(), ".sig") {
+			removed++ // a signature belongs to its binary's entry
+		}
+	}
+
+	return removed, c.writeManifest(entries)
+}
@@ -0,0 +1,103 @@
+package cacher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildIDHash(t *testing.T) {
+	var id = BuildID{
+		CommitSHA:     "abc123",
+		GoVersion:     "1.11",
+		TargetTriple:  "linux/amd64",
+		LDFlags:       "-s",
+		GCFlags:       "",
+		GOOS:          "linux",
+		GOARCH:        "amd64",
+		BlueprintHash: "deadbeef",
+	}
+
+	if id.Hash() != id.Hash() {
+		t.Fatal("Hash() is not deterministic for the same BuildID")
+	}
+
+	var other = id
+	other.LDFlags = "-w"
+	if id.Hash() == other.Hash() {
+		t.Fatal("Hash() must change when an input field changes")
+	}
+}
+
+func newTestCache(t *testing.T) (*Cache, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "cacher-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %s", err.Error())
+	}
+
+	c, err := OpenOrCreate(dir)
+	if err != nil {
+		t.Fatalf("OpenOrCreate: %s", err.Error())
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func TestGCRemovesOnlyStaleManifestEntries(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(filepath.Join(c.root, "stale"), []byte("x"), 0644); err != nil {
+		t.Fatalf("writing stale entry: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(c.root, "fresh"), []byte("x"), 0644); err != nil {
+		t.Fatalf("writing fresh entry: %s", err.Error())
+	}
+
+	var entries = map[string]manifestEntry{
+		"stale": {Hash: "stale", LastUsed: time.Now().Add(-48 * time.Hour)},
+		"fresh": {Hash: "fresh", LastUsed: time.Now()},
+	}
+	if err := c.writeManifest(entries); err != nil {
+		t.Fatalf("writeManifest: %s", err.Error())
+	}
+
+	removed, err := c.GC(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("GC: %s", err.Error())
+	}
+	if removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+	if _, err := os.Stat(filepath.Join(c.root, "stale")); !os.IsNotExist(err) {
+		t.Error("stale entry should have been removed")
+	}
+	if _, err := os.Stat(filepath.Join(c.root, "fresh")); err != nil {
+		t.Error("fresh entry should not have been removed")
+	}
+}
+
+func TestGCFallsBackToMtimeForUnseenEntries(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(filepath.Join(c.root, "unseen-fresh"), []byte("x"), 0644); err != nil {
+		t.Fatalf("writing entry: %s", err.Error())
+	}
+
+	// No manifest entry at all - this mirrors a build whose touch() hasn't
+	// landed yet. It's newly written, so its mtime is recent and GC must
+	// not delete it.
+	removed, err := c.GC(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("GC: %s", err.Error())
+	}
+	if removed != 0 {
+		t.Fatalf("removed = %d, want 0 for a fresh unseen entry", removed)
+	}
+	if _, err := os.Stat(filepath.Join(c.root, "unseen-fresh")); err != nil {
+		t.Error("fresh unseen entry should not have been removed")
+	}
+}
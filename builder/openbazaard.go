@@ -1,7 +1,10 @@
 package builder
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,6 +17,7 @@ import (
 	"github.com/OpenBazaar/mason/util"
 	"github.com/op/go-logging"
 	shell "github.com/placer14/go-shell"
+	"go.uber.org/multierr"
 )
 
 const GO_BUILD_VERSION = "1.11"
@@ -27,75 +31,297 @@ type openBazaarBuilder struct {
 	friendlyLabel    string
 	versionReference string
 	workDir          string
-	targetOS         string
-	targetArch       string
+	ldflags          string
+	gcflags          string
+	signer           Signer
+	verifier         runner.Verifier
 }
 
-func NewOpenBazaarDaemon(label, version string) *openBazaarBuilder {
+// Option configures optional behavior on an openBazaarBuilder at construction
+// time.
+type Option func(*openBazaarBuilder)
+
+// WithLDFlags passes the given string through to xgo's "-ldflags" on every
+// build, and folds it into the cache's BuildID so a flag change invalidates
+// stale entries.
+func WithLDFlags(flags string) Option {
+	return func(b *openBazaarBuilder) { b.ldflags = flags }
+}
+
+// WithGCFlags passes the given string through to xgo's "-gcflags" on every
+// build, and folds it into the cache's BuildID so a flag change invalidates
+// stale entries.
+func WithGCFlags(flags string) Option {
+	return func(b *openBazaarBuilder) { b.gcflags = flags }
+}
+
+// Signer produces a detached signature over the bytes read from r. It's
+// invoked once per produced binary, after generateOSSpecificBuild and before
+// the binary is cached.
+type Signer func(r io.Reader) ([]byte, error)
+
+// WithSigner signs every produced binary with s, caching the detached
+// signature alongside it as "<binary>.sig".
+func WithSigner(s Signer) Option {
+	return func(b *openBazaarBuilder) { b.signer = s }
+}
+
+// WithVerifier verifies a cached signature (if one exists) against its
+// binary before handing back a runner, failing the build if verification
+// fails.
+func WithVerifier(v runner.Verifier) Option {
+	return func(b *openBazaarBuilder) { b.verifier = v }
+}
+
+func NewOpenBazaarDaemon(label, version string, opts ...Option) *openBazaarBuilder {
 	var homeDir = os.Getenv("HOME")
 	if homeDir == "" {
 		log.Warningf("HOME is unset, using current path")
 		homeDir = "."
 	}
-	return &openBazaarBuilder{
+	var b = &openBazaarBuilder{
 		friendlyLabel:    label,
 		versionReference: version,
 		cachePath:        filepath.Join(homeDir, ".mason", "cache"),
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
-func (b *openBazaarBuilder) Build() (*runner.OpenBazaarRunner, error) {
+// Target describes a single artifact samulator should produce: a specific
+// goos/goarch combination handed straight to xgo's "-targets" flag.
+type Target struct {
+	GOOS   string
+	GOARCH string
+}
+
+// String renders the target as the goos/goarch triple xgo expects.
+func (t Target) String() string {
+	return fmt.Sprintf("%s/%s", t.GOOS, t.GOARCH)
+}
+
+// defaultTarget mirrors the previous behavior of building for whatever OS/arch
+// samulator itself is running on.
+func defaultTarget() Target {
+	var parts = strings.Split(util.GetXGoBuildTarget(), "/")
+	return Target{GOOS: parts[0], GOARCH: parts[1]}
+}
+
+// buildContext carries everything a single Build call shares across all of
+// its Targets: the inflated source's workDir, the resolved Go toolchain
+// version, the on-disk cache, the requested version reference, and a
+// semaphore that throttles concurrent xgo invocations to runtime.NumCPU().
+type buildContext struct {
+	workDir   string
+	goVersion string
+	cache     *cacher.Cache
+	version   string
+	ldflags   string
+	gcflags   string
+	signer    Signer
+	verifier  runner.Verifier
+	sem       chan struct{}
+}
+
+// Build fans a single inflate+checkout of the source out across every
+// requested Target, cross-compiling up to runtime.NumCPU() of them at a time.
+// Per-target failures are aggregated via multierr rather than aborting the
+// whole batch, so callers still get back every runner that did build.
+func (b *openBazaarBuilder) Build(ctx context.Context, targets ...Target) ([]*runner.OpenBazaarRunner, error) {
+	runners, err := b.buildOrdered(ctx, targets)
+	var successful = make([]*runner.OpenBazaarRunner, 0, len(runners))
+	for _, r := range runners {
+		if r != nil {
+			successful = append(successful, r)
+		}
+	}
+	return successful, err
+}
+
+// buildOrdered is Build's fan-out, but returns one slot per requested
+// Target (nil where that Target's build failed) so callers that need to
+// correlate a Target back to its runner - like Archive - don't have to
+// guess at completion order.
+func (b *openBazaarBuilder) buildOrdered(ctx context.Context, targets []Target) ([]*runner.OpenBazaarRunner, error) {
+	if len(targets) == 0 {
+		targets = []Target{defaultTarget()}
+	}
+
 	c, err := cacher.OpenOrCreate(b.cachePath)
 	if err != nil {
 		log.Warningf("failed opening cache (%s): %s", b.cachePath, err.Error())
 	}
-	if runnerPath, err := c.Get("openbazaard", b.versionReference); err == nil {
-		return runner.FromBinaryPath(runnerPath)
-	}
 
 	b.Lock()
-	defer b.Unlock()
-
 	b.workDir = util.GenerateTempBuildPath(b.friendlyLabel)
+	b.Unlock()
 	log.Infof("building at %s", b.workDir)
 
 	src, err := blueprints.InflateOpenBazaarDaemon(b.workDir)
 	if err != nil {
-		return nil, fmt.Errorf("inflating source: %s", err.Error())
+		return make([]*runner.OpenBazaarRunner, len(targets)), fmt.Errorf("inflating source: %s", err.Error())
 	}
-
 	if err := src.CheckoutVersion(b.versionReference); err != nil {
-		return nil, fmt.Errorf("checkout version: %s", err.Error())
+		return make([]*runner.OpenBazaarRunner, len(targets)), fmt.Errorf("checkout version: %s", err.Error())
+	}
+
+	var bc = &buildContext{
+		workDir:   b.workDir,
+		goVersion: GO_BUILD_VERSION,
+		cache:     c,
+		version:   b.versionReference,
+		ldflags:   b.ldflags,
+		gcflags:   b.gcflags,
+		signer:    b.signer,
+		verifier:  b.verifier,
+		sem:       make(chan struct{}, runtime.NumCPU()),
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		runners = make([]*runner.OpenBazaarRunner, len(targets))
+		errs    error
+	)
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+
+			select {
+			case bc.sem <- struct{}{}:
+				defer func() { <-bc.sem }()
+			case <-ctx.Done():
+				mu.Lock()
+				errs = multierr.Append(errs, fmt.Errorf("%s: %s", t, ctx.Err()))
+				mu.Unlock()
+				return
+			}
+
+			r, err := bc.build(src, t)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("building %s: %s", t, err.Error()))
+				return
+			}
+			runners[i] = r
+		}(i, t)
+	}
+	wg.Wait()
+
+	return runners, errs
+}
+
+// build produces (or fetches from cache) the runner for a single Target.
+func (bc *buildContext) build(src *blueprints.OpenBazaarSource, t Target) (*runner.OpenBazaarRunner, error) {
+	commitSHA, err := src.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("resolving commit: %s", err.Error())
+	}
+	inflationHash, err := src.InflationHash()
+	if err != nil {
+		return nil, fmt.Errorf("hashing source: %s", err.Error())
+	}
+	var id = cacher.BuildID{
+		CommitSHA:     commitSHA,
+		GoVersion:     bc.goVersion,
+		TargetTriple:  t.String(),
+		LDFlags:       bc.ldflags,
+		GCFlags:       bc.gcflags,
+		GOOS:          t.GOOS,
+		GOARCH:        t.GOARCH,
+		BlueprintHash: inflationHash,
 	}
 
-	buildPath, err := generateOSSpecificBuild(src)
+	// ~/.mason/cache is shared across concurrent CI invocations, so hold a
+	// cross-process lock on this build ID across the Get, the build and the
+	// Cache: a second process racing on the same ID blocks here, then finds
+	// the entry the first one cached instead of running xgo again.
+	lock, err := bc.cache.Lock(id)
 	if err != nil {
-		return nil, fmt.Errorf("building for %s: %s", runtime.GOOS, err.Error())
+		return nil, fmt.Errorf("locking cache entry: %s", err.Error())
 	}
+	defer lock.Unlock()
 
-	if err := c.Cache("openbazaard", b.versionReference, buildPath); err != nil {
-		log.Warningf("failed caching build for %s (%s): %s", "openbazaard", b.versionReference, err.Error())
+	if runnerPath, sigPath, err := bc.cache.Get(id); err == nil {
+		return runner.FromBinaryPath(runnerPath, bc.runnerOpts(sigPath)...)
+	}
+
+	buildPath, err := generateOSSpecificBuild(src, t, bc.ldflags, bc.gcflags)
+	if err != nil {
+		return nil, fmt.Errorf("building for %s: %s", t, err.Error())
+	}
+
+	var sigPath string
+	if bc.signer != nil {
+		sigPath, err = signBuildOutput(bc.signer, buildPath)
+		if err != nil {
+			return nil, fmt.Errorf("signing build: %s", err.Error())
+		}
+	}
+
+	if err := bc.cache.Cache(id, buildPath, sigPath); err != nil {
 		return nil, fmt.Errorf("caching build: %s", err.Error())
 	}
 
-	runnerPath, err := c.Get("openbazaard", b.versionReference)
+	runnerPath, cachedSigPath, err := bc.cache.Get(id)
 	if err != nil {
 		return nil, fmt.Errorf("retrieving cached build: %s", err.Error())
 	}
-	return runner.FromBinaryPath(runnerPath)
+	return runner.FromBinaryPath(runnerPath, bc.runnerOpts(cachedSigPath)...)
 }
 
-func generateOSSpecificBuild(src *blueprints.OpenBazaarSource) (string, error) {
+// runnerOpts wires signature verification into runner.FromBinaryPath when
+// both a cached signature and a verifier are available.
+func (bc *buildContext) runnerOpts(sigPath string) []runner.Option {
+	if sigPath == "" || bc.verifier == nil {
+		return nil
+	}
+	return []runner.Option{runner.WithSignatureVerification(sigPath, bc.verifier)}
+}
+
+// signBuildOutput streams buildPath through sign and writes the resulting
+// detached signature to "<buildPath>.sig".
+func signBuildOutput(sign Signer, buildPath string) (string, error) {
+	f, err := os.Open(buildPath)
+	if err != nil {
+		return "", fmt.Errorf("opening binary: %s", err.Error())
+	}
+	defer f.Close()
+
+	sig, err := sign(f)
+	if err != nil {
+		return "", fmt.Errorf("signing: %s", err.Error())
+	}
+
+	var sigPath = buildPath + ".sig"
+	if err := ioutil.WriteFile(sigPath, sig, 0644); err != nil {
+		return "", fmt.Errorf("writing signature: %s", err.Error())
+	}
+	return sigPath, nil
+}
+
+func generateOSSpecificBuild(src *blueprints.OpenBazaarSource, t Target, ldflags, gcflags string) (string, error) {
+	var buildArgs = []string{
+		"xgo", "-v", "-targets", t.String(), // build arch/OS target
+		"-dest=./dest",             // build destination path
+		"-out", src.BinaryPrefix(), // binary name prefix
+		"-go", GO_BUILD_VERSION, // specific go build version
+	}
+	if ldflags != "" {
+		buildArgs = append(buildArgs, "-ldflags", ldflags)
+	}
+	if gcflags != "" {
+		buildArgs = append(buildArgs, "-gcflags", gcflags)
+	}
+	buildArgs = append(buildArgs, filepath.Join(src.WorkDir(), "src", "github.com", "OpenBazaar", "openbazaar-go"))
+
 	var (
-		getXGo      = shell.Cmd("go", "get", "github.com/karalabe/xgo")
-		buildBinary = shell.Cmd(
-			fmt.Sprintf("GOPATH=%s", src.WorkDir()),
-			"xgo", "-v", "-targets", util.GetXGoBuildTarget(), // build arch/OS targets
-			"-dest=./dest",             // build destination path
-			"-out", src.BinaryPrefix(), // binary name prefix
-			"-go", GO_BUILD_VERSION, // specific go build version
-			filepath.Join(src.WorkDir(), "src", "github.com", "OpenBazaar", "openbazaar-go"),
-		)
+		getXGo        = shell.Cmd("go", "get", "github.com/karalabe/xgo")
+		buildBinary   = shell.Cmd(append([]string{fmt.Sprintf("GOPATH=%s", src.WorkDir())}, buildArgs...)...)
 		buildCommands = []*shell.Command{getXGo, buildBinary}
 	)
 	for _, cmd := range buildCommands {
@@ -107,15 +333,11 @@ func generateOSSpecificBuild(src *blueprints.OpenBazaarSource) (string, error) {
 			return "", fmt.Errorf("non-zero build exit: %s", proc.Error())
 		}
 	}
-	return binaryPath(src), nil
+	return binaryPath(src, t), nil
 }
 
-func binaryPath(src *blueprints.OpenBazaarSource) string {
-	var (
-		targets        = strings.Split(util.GetXGoBuildTarget(), "/")
-		os, arch       = targets[0], targets[1]
-		binaryFilename = fmt.Sprintf("%s-%s-10.6-%s", src.BinaryPrefix(), os, arch)
-	)
+func binaryPath(src *blueprints.OpenBazaarSource, t Target) string {
+	var binaryFilename = fmt.Sprintf("%s-%s-10.6-%s", src.BinaryPrefix(), t.GOOS, t.GOARCH)
 	return filepath.Join(src.WorkDir(), "dest", binaryFilename)
 }
 
@@ -0,0 +1,19 @@
+package builder
+
+import "testing"
+
+func TestTargetString(t *testing.T) {
+	var cases = []struct {
+		target Target
+		want   string
+	}{
+		{Target{GOOS: "linux", GOARCH: "amd64"}, "linux/amd64"},
+		{Target{GOOS: "darwin", GOARCH: "arm64"}, "darwin/arm64"},
+		{Target{GOOS: "windows", GOARCH: "386"}, "windows/386"},
+	}
+	for _, c := range cases {
+		if got := c.target.String(); got != c.want {
+			t.Errorf("Target%+v.String() = %q, want %q", c.target, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// OpenBazaarRunner wraps a built openbazaard binary so callers can exec it
+// without knowing where samulator cached it.
+type OpenBazaarRunner struct {
+	binaryPath string
+}
+
+// Verifier checks a detached signature against the bytes read from binary,
+// returning an error if it doesn't match.
+type Verifier func(binary *os.File, signature []byte) error
+
+// Option configures optional behavior when wrapping a binary.
+type Option func(*OpenBazaarRunner) error
+
+// WithSignatureVerification reads the detached signature at sigPath and
+// runs verify against the wrapped binary before FromBinaryPath returns,
+// failing closed if the signature is missing or doesn't check out.
+func WithSignatureVerification(sigPath string, verify Verifier) Option {
+	return func(r *OpenBazaarRunner) error {
+		sig, err := ioutil.ReadFile(sigPath)
+		if err != nil {
+			return fmt.Errorf("reading signature (%s): %s", sigPath, err.Error())
+		}
+		f, err := os.Open(r.binaryPath)
+		if err != nil {
+			return fmt.Errorf("opening binary: %s", err.Error())
+		}
+		defer f.Close()
+		if err := verify(f, sig); err != nil {
+			return fmt.Errorf("verifying signature: %s", err.Error())
+		}
+		return nil
+	}
+}
+
+// FromBinaryPath wraps an already-built binary at path, applying any opts -
+// e.g. signature verification - before returning.
+func FromBinaryPath(path string, opts ...Option) (*OpenBazaarRunner, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("locating binary (%s): %s", path, err.Error())
+	}
+	var r = &OpenBazaarRunner{binaryPath: path}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// BinaryPath returns the on-disk location of the wrapped binary.
+func (r *OpenBazaarRunner) BinaryPath() string {
+	return r.binaryPath
+}
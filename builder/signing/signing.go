@@ -0,0 +1,56 @@
+// Package signing provides builder.Signer implementations for producing
+// detached signatures over samulator's build output.
+package signing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/OpenBazaar/mason/builder"
+	"golang.org/x/crypto/openpgp"
+)
+
+// GPG returns a builder.Signer that produces an ASCII-armored detached
+// signature with the first private key found in keyRing, decrypting it with
+// passphrase first if it's encrypted.
+func GPG(keyRing io.Reader, passphrase string) (builder.Signer, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(keyRing)
+	if err != nil {
+		return nil, fmt.Errorf("reading key ring: %s", err.Error())
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("key ring contains no entities")
+	}
+
+	var signer *openpgp.Entity
+	for _, e := range entities {
+		if e.PrivateKey != nil {
+			signer = e
+			break
+		}
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("key ring contains no private key")
+	}
+	if passphrase != "" && signer.PrivateKey != nil && signer.PrivateKey.Encrypted {
+		if err := signer.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("decrypting private key: %s", err.Error())
+		}
+	}
+
+	return func(r io.Reader) ([]byte, error) {
+		var sig bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&sig, signer, r, nil); err != nil {
+			return nil, fmt.Errorf("gpg detached sign: %s", err.Error())
+		}
+		return sig.Bytes(), nil
+	}, nil
+}
+
+// Minisign returns a builder.Signer backed by a minisign/ed25519 private
+// key. Not yet implemented - release engineering hasn't settled on a key
+// format, so this is a stub to build the WithSigner call site against.
+func Minisign(privateKeyPath string) (builder.Signer, error) {
+	return nil, fmt.Errorf("minisign signing is not yet implemented")
+}
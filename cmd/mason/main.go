@@ -0,0 +1,105 @@
+// Command mason drives samulator's builder from the command line.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/OpenBazaar/mason/builder"
+	"github.com/OpenBazaar/mason/builder/cacher"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "cache":
+		runCache(os.Args[2:])
+	case "bench":
+		runBench(os.Args[2:])
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: mason cache gc [--max-age 168h]")
+	fmt.Fprintln(os.Stderr, "       mason bench --from <ref> --to <ref> --bench <patterns> --packages <pkgs> [--reuse-workpath]")
+}
+
+func runCache(args []string) {
+	if len(args) < 1 || args[0] != "gc" {
+		usage()
+		os.Exit(1)
+	}
+
+	var (
+		fs        = flag.NewFlagSet("cache gc", flag.ExitOnError)
+		maxAge    = fs.Duration("max-age", 7*24*time.Hour, "prune entries unused for longer than this")
+		cachePath = fs.String("path", defaultCachePath(), "cache directory to prune")
+	)
+	fs.Parse(args[1:])
+
+	c, err := cacher.OpenOrCreate(*cachePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening cache (%s): %s\n", *cachePath, err.Error())
+		os.Exit(1)
+	}
+
+	removed, err := c.GC(*maxAge)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gc: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("removed %d stale cache entries\n", removed)
+}
+
+func runBench(args []string) {
+	var (
+		fs            = flag.NewFlagSet("bench", flag.ExitOnError)
+		from          = fs.String("from", "", "commit/ref to start benchmarking from (exclusive)")
+		to            = fs.String("to", "", "commit/ref to benchmark through (inclusive)")
+		benchPatterns = fs.String("bench", ".", "comma-separated -bench patterns passed to `go test`")
+		packages      = fs.String("packages", "", "comma-separated openbazaar-go packages to benchmark, e.g. core,repo/db")
+		reuseWorkpath = fs.Bool("reuse-workpath", false, "reuse the builder's previous workDir instead of re-inflating the source; each mason run starts a new builder with no previous workDir, so the source is always inflated")
+		label         = fs.String("label", "openbazaard", "friendly label for the built binary")
+	)
+	fs.Parse(args)
+
+	if *from == "" || *to == "" || *packages == "" {
+		usage()
+		os.Exit(1)
+	}
+
+	var b = builder.NewOpenBazaarDaemon(*label, *to)
+	results, err := b.BenchmarkAcross(context.Background(), *from, *to, strings.Split(*benchPatterns, ","), builder.BenchmarkOptions{
+		Packages:      strings.Split(*packages, ","),
+		ReuseWorkpath: *reuseWorkpath,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "benchmarking: %s\n", err.Error())
+	}
+	for _, r := range results {
+		fmt.Printf("%s\t%s\t%s\t%g\n", r.Hash, r.Benchmark, r.Metric, r.Value)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func defaultCachePath() string {
+	var homeDir = os.Getenv("HOME")
+	if homeDir == "" {
+		homeDir = "."
+	}
+	return filepath.Join(homeDir, ".mason", "cache")
+}
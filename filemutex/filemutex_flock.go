@@ -0,0 +1,42 @@
+// +build !windows
+
+package filemutex
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FileMutex is an exclusive lock backed by a file on disk, held via flock(2)
+// so it's respected across process boundaries - not just goroutines within
+// one process.
+type FileMutex struct {
+	f *os.File
+}
+
+// New opens (creating if necessary) the lockfile at path. The file isn't
+// locked until Lock is called.
+func New(path string) (*FileMutex, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lockfile (%s): %s", path, err.Error())
+	}
+	return &FileMutex{f: f}, nil
+}
+
+// Lock blocks until it holds an exclusive lock on the file.
+func (m *FileMutex) Lock() error {
+	if err := syscall.Flock(int(m.f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("flock (%s): %s", m.f.Name(), err.Error())
+	}
+	return nil
+}
+
+// Unlock releases the lock and closes the underlying file.
+func (m *FileMutex) Unlock() error {
+	if err := syscall.Flock(int(m.f.Fd()), syscall.LOCK_UN); err != nil {
+		return fmt.Errorf("unflock (%s): %s", m.f.Name(), err.Error())
+	}
+	return m.f.Close()
+}
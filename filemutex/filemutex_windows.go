@@ -0,0 +1,60 @@
+// +build windows
+
+package filemutex
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const lockfileExclusiveLock = 2
+
+// FileMutex is an exclusive lock backed by a file on disk, held via
+// LockFileEx so it's respected across process boundaries - not just
+// goroutines within one process.
+type FileMutex struct {
+	f *os.File
+}
+
+// New opens (creating if necessary) the lockfile at path. The file isn't
+// locked until Lock is called.
+func New(path string) (*FileMutex, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lockfile (%s): %s", path, err.Error())
+	}
+	return &FileMutex{f: f}, nil
+}
+
+// Lock blocks until it holds an exclusive lock on the file.
+func (m *FileMutex) Lock() error {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(
+		m.f.Fd(), uintptr(lockfileExclusiveLock), 0, 0xFFFFFFFF, 0xFFFFFFFF,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if r == 0 {
+		return fmt.Errorf("LockFileEx (%s): %s", m.f.Name(), err.Error())
+	}
+	return nil
+}
+
+// Unlock releases the lock and closes the underlying file.
+func (m *FileMutex) Unlock() error {
+	var overlapped syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(
+		m.f.Fd(), 0, 0xFFFFFFFF, 0xFFFFFFFF, uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if r == 0 {
+		return fmt.Errorf("UnlockFileEx (%s): %s", m.f.Name(), err.Error())
+	}
+	return m.f.Close()
+}
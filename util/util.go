@@ -0,0 +1,23 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+)
+
+// GetXGoBuildTarget returns the xgo target triple for the platform samulator
+// is running on, e.g. "linux/amd64".
+func GetXGoBuildTarget() string {
+	return fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// GenerateTempBuildPath returns a fresh scratch directory, named after the
+// friendly label, under the OS temp dir.
+func GenerateTempBuildPath(label string) string {
+	dir, err := ioutil.TempDir("", fmt.Sprintf("mason-%s-", label))
+	if err != nil {
+		panic(err.Error())
+	}
+	return dir
+}